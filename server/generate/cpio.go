@@ -0,0 +1,67 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// cpioArchive - A minimal cpio-newc ("070701") writer, just enough to wrap a
+// single stager binary for initramfs delivery
+type cpioArchive struct {
+	buf   bytes.Buffer
+	inode uint32
+}
+
+func newCPIOArchive() *cpioArchive {
+	return &cpioArchive{}
+}
+
+// addFile - Appends a regular file entry (name + data) to the archive.
+// writeHeader already pads the header+name segment to a 4-byte boundary, so
+// only the data segment's own length needs padding here.
+func (a *cpioArchive) addFile(name string, data []byte, mode uint32) {
+	a.inode++
+	a.writeHeader(name, uint32(len(data)), mode, a.inode)
+	a.buf.Write(data)
+	a.pad(len(data))
+}
+
+// addTrailer - Writes the cpio-newc end-of-archive marker. writeHeader
+// already pads the header+name segment, and the trailer carries no data, so
+// there's nothing left to pad.
+func (a *cpioArchive) addTrailer() {
+	a.writeHeader("TRAILER!!!", 0, 0, 0)
+}
+
+// writeHeader - Writes a 110-byte newc header followed by the NUL-terminated
+// filename, padded to a 4-byte boundary
+func (a *cpioArchive) writeHeader(name string, fileSize, mode, ino uint32) {
+	fmt.Fprintf(&a.buf, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		ino,             // c_ino
+		mode,            // c_mode
+		0,               // c_uid
+		0,               // c_gid
+		1,               // c_nlink
+		0,               // c_mtime
+		fileSize,        // c_filesize
+		0, 0,            // c_devmajor, c_devminor
+		0, 0,            // c_rdevmajor, c_rdevminor
+		len(name)+1,     // c_namesize
+		0,               // c_check
+	)
+	a.buf.WriteString(name)
+	a.buf.WriteByte(0)
+	a.pad(110 + len(name) + 1)
+}
+
+// pad - cpio-newc pads header+data to 4-byte boundaries
+func (a *cpioArchive) pad(written int) {
+	if rem := written % 4; rem != 0 {
+		a.buf.Write(make([]byte, 4-rem))
+	}
+}
+
+// Bytes - The assembled archive
+func (a *cpioArchive) Bytes() []byte {
+	return a.buf.Bytes()
+}
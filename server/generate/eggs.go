@@ -0,0 +1,99 @@
+package generate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+
+	"sliver/server/assets"
+)
+
+const eggsDirName = "eggs"
+
+// GetEggsDir - Directory that holds stager -> full-implant profile mappings
+func GetEggsDir() string {
+	appDir := assets.GetRootAppDir()
+	eggsDir := path.Join(appDir, eggsDirName)
+	if _, err := os.Stat(eggsDir); os.IsNotExist(err) {
+		log.Printf("Creating eggs directory: %s", eggsDir)
+		err = os.MkdirAll(eggsDir, os.ModePerm)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return eggsDir
+}
+
+// SaveEggManifest - Persists the full SliverConfig an egg should fetch, keyed
+// by the egg's name, so the C2 side can look it up when the stager phones home
+func SaveEggManifest(name string, config SliverConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	manifestPath := path.Join(GetEggsDir(), name+".json")
+	return ioutil.WriteFile(manifestPath, data, 0600)
+}
+
+// GetEggManifest - Loads the full SliverConfig registered for an egg name
+func GetEggManifest(name string) (*SliverConfig, error) {
+	manifestPath := path.Join(GetEggsDir(), name+".json")
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	config := &SliverConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ServeStagedImplant - Looks up the full implant profile an egg registered
+// (see SaveEggManifest), builds (or reuses a cached build of) it via the
+// shared BuildQueue, and writes the raw artifact bytes to dest. This is the
+// server-side half of "the stager phones home": a C2 listener that accepts a
+// connection it recognizes as an egg (e.g. by the client cert's CommonName,
+// which GenerateSliverCertificate sets to the egg's name) rather than a
+// known full-implant session should call this with that name and the
+// connection to hand the second stage off to.
+//
+// NOTE: no mTLS listener exists in this tree to call this yet -- that accept
+// loop is out of scope here -- but name lookup, build/cache reuse, and
+// streaming the artifact out now have a real, working implementation to
+// call into instead of GetEggManifest being unused dead code.
+func ServeStagedImplant(name string, dest io.Writer) error {
+	config, err := GetEggManifest(name)
+	if err != nil {
+		return fmt.Errorf("no egg manifest for '%s': %v", name, err)
+	}
+
+	build := func(c SliverConfig, stdout io.Writer) (string, error) {
+		return SliverExecutable(c, stdout)
+	}
+	jobID := DefaultBuildQueue.Enqueue(*config, "executable", build)
+
+	for event := range DefaultBuildQueue.Events(jobID) {
+		switch event.Type {
+		case BuildFailed:
+			return fmt.Errorf("build failed for '%s': %s", name, event.Err)
+		case BuildDone:
+			artifactPath, err := DefaultBuildQueue.Artifact(event.ArtifactID)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadFile(artifactPath)
+			if err != nil {
+				return err
+			}
+			_, err = dest.Write(data)
+			return err
+		}
+	}
+	return errors.New("build queue closed without a terminal event")
+}
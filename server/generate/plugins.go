@@ -0,0 +1,63 @@
+package generate
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+
+	"sliver/server/core"
+
+	"github.com/gobuffalo/packr"
+)
+
+// sliverBoxDir - Relative path (from this package) to the implant source
+// tree that sliverBox/srcFiles are rendered from
+const sliverBoxDir = "../../sliver"
+
+// sliverBoxAbsDir - sliverBoxDir resolved to an absolute path relative to
+// this source file, the same way packr.NewBox resolves it internally.
+// os.MkdirAll/ioutil.WriteFile (unlike packr) resolve relative paths against
+// the process's working directory, so staging plugin payloads with the bare
+// relative string would write them somewhere other than the box packr/
+// binaries.go actually reads from.
+var sliverBoxAbsDir = func() string {
+	_, thisFile, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(thisFile), sliverBoxDir)
+}()
+
+// pluginSrcFiles - Implant source files staged by loaded plugins (paths
+// relative to sliverBoxDir), rendered alongside srcFiles so the implant is
+// compiled with the matching capability
+var pluginSrcFiles []string
+
+// RegisterPluginPayloads - Called once per loaded plugin at server startup
+// (see rpc.LoadPlugins). Copies the plugin's declared implant source into
+// the sliver source tree under plugins/<name>/ so it renders and compiles
+// alongside the rest of srcFiles.
+func RegisterPluginPayloads(name string, payloads []core.SliverPayloadDescriptor) {
+	for _, payload := range payloads {
+		if payload.SourceDir == "" {
+			continue
+		}
+		box := packr.NewBox(payload.SourceDir)
+		for _, file := range payload.SourceFiles {
+			contents, err := box.FindString(file)
+			if err != nil {
+				log.Printf("[plugin] %s: missing source file %s: %v", name, file, err)
+				continue
+			}
+			relPath := path.Join("plugins", name, file)
+			destPath := filepath.Join(sliverBoxAbsDir, relPath)
+			os.MkdirAll(filepath.Dir(destPath), os.ModePerm)
+			if err := ioutil.WriteFile(destPath, []byte(contents), 0644); err != nil {
+				log.Printf("[plugin] %s: failed to stage %s: %v", name, file, err)
+				continue
+			}
+			pluginSrcFiles = append(pluginSrcFiles, relPath)
+			log.Printf("[plugin] staged %s -> %s", name, relPath)
+		}
+	}
+}
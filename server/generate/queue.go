@@ -0,0 +1,261 @@
+package generate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// BuildJobID - Identifies a single enqueued build
+type BuildJobID string
+
+// BuildEventType - Discrete stages of a build job's lifecycle
+type BuildEventType int
+
+const (
+	// BuildQueued - Job accepted, waiting for a free worker
+	BuildQueued BuildEventType = iota
+	// BuildRenderingSource - Templates are being rendered into the project GOPATH
+	BuildRenderingSource
+	// BuildObfuscating - gobfuscate is rewriting the source tree
+	BuildObfuscating
+	// BuildCompiling - go build is running
+	BuildCompiling
+	// BuildDone - Build succeeded; ArtifactID identifies the cached artifact
+	BuildDone
+	// BuildFailed - Build failed; Err has the reason
+	BuildFailed
+)
+
+// BuildEvent - One update in a build job's lifecycle, streamed out over
+// rpcBuildEvents. Line is only set for BuildCompiling (tailed build output);
+// ArtifactID only for BuildDone; Err only for BuildFailed.
+type BuildEvent struct {
+	JobID      BuildJobID
+	Type       BuildEventType
+	Line       string
+	ArtifactID string
+	Err        string
+}
+
+// DefaultBuildWorkers - Concurrent compiles; gobfuscate + go build are CPU-heavy
+const DefaultBuildWorkers = 2
+
+// buildFunc - One of SliverExecutable/SliverSharedLibrary/(egg+packaging),
+// whatever rpcGenerate decided to enqueue. stdout is wired to a lineWriter so
+// the queue can tail gogo.GoBuild's compiler output as BuildCompiling events.
+type buildFunc func(config SliverConfig, stdout io.Writer) (string, error)
+
+// lineWriter - io.Writer that splits writes on newlines and invokes onLine
+// once per complete line, so a blocking call like gogo.GoBuild that writes
+// its compiler output through this can have that output tailed live instead
+// of read back only after the process exits.
+type lineWriter struct {
+	buf    bytes.Buffer
+	onLine func(string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			w.buf.WriteString(line) // incomplete line; wait for the rest
+			break
+		}
+		w.onLine(strings.TrimRight(line, "\n"))
+	}
+	return len(p), nil
+}
+
+// sendEvent - Non-blocking send: if events is full because no client has
+// called rpcBuildEvents to drain it (rpcGenerate returns the job ID before
+// any subscription happens, and nothing requires a client to ever connect),
+// the event is dropped rather than blocking the build goroutine forever --
+// a wedged send here would hold its worker slot for the life of the server.
+func sendEvent(events chan BuildEvent, event BuildEvent) {
+	select {
+	case events <- event:
+	default:
+		log.Printf("[buildqueue] %s: event channel full, dropping %v event", event.JobID, event.Type)
+	}
+}
+
+// BuildQueue - Runs generate pipelines on a bounded worker pool, streaming
+// progress events per job and caching completed artifacts by config hash so
+// identical regenerate requests return instantly.
+type BuildQueue struct {
+	workers chan struct{}
+
+	mu          sync.Mutex
+	events      map[BuildJobID]chan BuildEvent
+	lastEvent   map[BuildJobID]BuildEvent // terminal event, kept for replay after the channel drains
+	cache       map[string]string         // config+kind hash -> artifact ID
+	artifacts   map[string]string         // artifact ID -> filesystem path (never client-supplied)
+	jobCount    uint64
+	artifactSeq uint64
+}
+
+// NewBuildQueue - Caps concurrent compiles at maxWorkers (DefaultBuildWorkers if <= 0)
+func NewBuildQueue(maxWorkers int) *BuildQueue {
+	if maxWorkers <= 0 {
+		maxWorkers = DefaultBuildWorkers
+	}
+	return &BuildQueue{
+		workers:   make(chan struct{}, maxWorkers),
+		events:    make(map[BuildJobID]chan BuildEvent),
+		lastEvent: make(map[BuildJobID]BuildEvent),
+		cache:     make(map[string]string),
+		artifacts: make(map[string]string),
+	}
+}
+
+// DefaultBuildQueue - Package-level queue used by rpcGenerate
+var DefaultBuildQueue = NewBuildQueue(DefaultBuildWorkers)
+
+// Enqueue - Accepts a job and returns its ID immediately; the pipeline runs
+// on a worker goroutine and reports progress on the job's event channel,
+// which the caller reads via Events. kind distinguishes otherwise-identical
+// configs that produce different artifact types (executable/shared-lib/egg)
+// so they don't collide in the cache.
+func (q *BuildQueue) Enqueue(config SliverConfig, kind string, build buildFunc) BuildJobID {
+	jobID := q.nextJobID()
+	events := make(chan BuildEvent, 16)
+
+	q.mu.Lock()
+	q.events[jobID] = events
+	q.mu.Unlock()
+
+	sendEvent(events, BuildEvent{JobID: jobID, Type: BuildQueued})
+
+	go q.run(jobID, config, kind, build, events)
+	return jobID
+}
+
+func (q *BuildQueue) run(jobID BuildJobID, config SliverConfig, kind string, build buildFunc, events chan BuildEvent) {
+	// Resolve the name/cert material a build will actually use before
+	// hashing, so the cache key reflects what's really going to get compiled
+	// (and a cert/CA rotation can't leave a stale artifact served from cache)
+	config = populateIdentity(config)
+	configHash := hashConfig(config, kind)
+	q.mu.Lock()
+	cached, isCached := q.cache[configHash]
+	q.mu.Unlock()
+	if isCached {
+		log.Printf("[buildqueue] %s: cache hit (%s)", jobID, configHash[:12])
+		q.terminal(jobID, events, BuildEvent{JobID: jobID, Type: BuildDone, ArtifactID: cached})
+		return
+	}
+
+	q.workers <- struct{}{}
+	defer func() { <-q.workers }()
+
+	sendEvent(events, BuildEvent{JobID: jobID, Type: BuildRenderingSource})
+	if !config.Debug {
+		sendEvent(events, BuildEvent{JobID: jobID, Type: BuildObfuscating})
+	}
+	sendEvent(events, BuildEvent{JobID: jobID, Type: BuildCompiling})
+
+	stdout := &lineWriter{onLine: func(line string) {
+		sendEvent(events, BuildEvent{JobID: jobID, Type: BuildCompiling, Line: line})
+	}}
+	artifactPath, err := build(config, stdout)
+	if err != nil {
+		q.terminal(jobID, events, BuildEvent{JobID: jobID, Type: BuildFailed, Err: err.Error()})
+		return
+	}
+
+	artifactID := q.registerArtifact(artifactPath)
+	q.mu.Lock()
+	q.cache[configHash] = artifactID
+	q.mu.Unlock()
+
+	q.terminal(jobID, events, BuildEvent{JobID: jobID, Type: BuildDone, ArtifactID: artifactID})
+}
+
+// terminal - Sends a job's final event, remembers it for replay, and retires
+// the live channel so a later Events() call (e.g. after a dropped stream
+// reconnects) still learns the outcome instead of silently reading zero
+// events from a drained, closed channel. The send is non-blocking (like all
+// sends on events) so a job always finishes and frees its worker slot even
+// if nobody is listening.
+func (q *BuildQueue) terminal(jobID BuildJobID, events chan BuildEvent, event BuildEvent) {
+	sendEvent(events, event)
+	close(events)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.events, jobID)
+	q.lastEvent[jobID] = event
+}
+
+// Events - A channel of events for jobID, or nil if jobID is unknown. If the
+// job already finished, returns a fresh single-item channel replaying its
+// terminal event instead of the drained/closed original.
+func (q *BuildQueue) Events(jobID BuildJobID) chan BuildEvent {
+	q.mu.Lock()
+	live, isLive := q.events[jobID]
+	last, isDone := q.lastEvent[jobID]
+	q.mu.Unlock()
+
+	if isLive {
+		return live
+	}
+	if isDone {
+		replay := make(chan BuildEvent, 1)
+		replay <- last
+		close(replay)
+		return replay
+	}
+	return nil
+}
+
+// registerArtifact - Mints an opaque artifact ID for a completed build's
+// output path. IDs are server-generated and looked up via Artifact; a client
+// can never smuggle in an arbitrary filesystem path through ArtifactID.
+func (q *BuildQueue) registerArtifact(artifactPath string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.artifactSeq++
+	artifactID := fmt.Sprintf("artifact-%d", q.artifactSeq)
+	q.artifacts[artifactID] = artifactPath
+	return artifactID
+}
+
+// Artifact - Resolves a server-issued ArtifactID to its filesystem path for
+// rpcBuildArtifact to read and chunk out. Unknown IDs (including anything a
+// client fabricates) are rejected.
+func (q *BuildQueue) Artifact(artifactID string) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fpath, ok := q.artifacts[artifactID]
+	if !ok {
+		return "", fmt.Errorf("unknown artifact id: %s", artifactID)
+	}
+	return fpath, nil
+}
+
+func (q *BuildQueue) nextJobID() BuildJobID {
+	q.mu.Lock()
+	q.jobCount++
+	id := q.jobCount
+	q.mu.Unlock()
+	return BuildJobID(fmt.Sprintf("build-%d", id))
+}
+
+// hashConfig - Stable hash of a SliverConfig (including cert fingerprints)
+// plus the artifact kind being built, so identical regenerate requests share
+// a cache entry but an executable and a shared-lib build of the same config
+// don't collide
+func hashConfig(config SliverConfig, kind string) string {
+	data, _ := json.Marshal(config)
+	sum := sha256.New()
+	sum.Write(data)
+	sum.Write([]byte(kind))
+	return hex.EncodeToString(sum.Sum(nil))
+}
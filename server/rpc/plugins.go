@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"errors"
+	"log"
+	"path"
+	"path/filepath"
+	"plugin"
+
+	"sliver/server/assets"
+	"sliver/server/core"
+	"sliver/server/generate"
+)
+
+const pluginsDirName = "plugins"
+
+// rpcHandlers - The RPC dispatch table. Every rpcXxx function is registered
+// here; plugins extend it through Mux instead of editing this map directly.
+var rpcHandlers = map[string]func([]byte, RPCResponse){
+	"sessions":      rpcSessions,
+	"generate":      rpcGenerate,
+	"buildEvents":   rpcBuildEvents,
+	"buildArtifact": rpcBuildArtifact,
+	"profiles":      rpcProfiles,
+	"newProfile":    rpcNewProfile,
+	"ps":            rpcPs,
+	"procdump":      rpcProcdump,
+}
+
+// Mux - The concrete core.RPCMux backed by rpcHandlers
+type Mux struct{}
+
+// Handle - Registers a new RPC handler, implementing core.RPCMux. Refuses to
+// clobber an existing (core or already-plugin-registered) handler.
+func (Mux) Handle(msgName string, handler core.RPCHandler) {
+	if _, taken := rpcHandlers[msgName]; taken {
+		log.Printf("[plugin] refusing to overwrite existing handler %q", msgName)
+		return
+	}
+	rpcHandlers[msgName] = func(req []byte, resp RPCResponse) {
+		handler(req, resp)
+	}
+}
+
+// LoadPlugins - Walks ~/.sliver/plugins/*.so, opens each as a Go plugin,
+// looks up its exported "Plugin" symbol, and registers it
+func LoadPlugins() {
+	pluginsDir := path.Join(assets.GetRootAppDir(), pluginsDirName)
+	matches, err := filepath.Glob(path.Join(pluginsDir, "*.so"))
+	if err != nil || len(matches) == 0 {
+		return
+	}
+
+	mux := Mux{}
+	for _, soPath := range matches {
+		plug, err := loadPlugin(soPath)
+		if err != nil {
+			log.Printf("[plugin] %s: %v", soPath, err)
+			continue
+		}
+		if err := plug.Register(mux); err != nil {
+			log.Printf("[plugin] %s failed to register: %v", plug.Name(), err)
+			continue
+		}
+		generate.RegisterPluginPayloads(plug.Name(), plug.SliverPayloads())
+		log.Printf("[plugin] loaded %s (%s)", plug.Name(), soPath)
+	}
+}
+
+// loadPlugin - plugin.Open + Lookup("Plugin") + type assertion to core.Plugin
+func loadPlugin(soPath string) (core.Plugin, error) {
+	p, err := plugin.Open(soPath)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("Plugin")
+	if err != nil {
+		return nil, err
+	}
+	plug, ok := sym.(core.Plugin)
+	if !ok {
+		return nil, errors.New("exported Plugin symbol does not implement core.Plugin")
+	}
+	return plug, nil
+}
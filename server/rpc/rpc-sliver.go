@@ -1,8 +1,10 @@
 package rpc
 
 import (
-	"io/ioutil"
+	"fmt"
+	"io"
 	"log"
+	"os"
 	"path"
 	pb "sliver/protobuf/client"
 	"sliver/server/core"
@@ -14,6 +16,10 @@ import (
 	"github.com/golang/protobuf/proto"
 )
 
+// buildArtifactChunkSize - Frame size for rpcBuildArtifact so large DLLs/ISOs
+// don't need to fit in a single protobuf message
+const buildArtifactChunkSize = 64 * 1024
+
 func rpcSessions(_ []byte, resp RPCResponse) {
 	sessions := &pb.Sessions{}
 	if 0 < len(*core.Hive.Slivers) {
@@ -41,6 +47,10 @@ func rpcSessions(_ []byte, resp RPCResponse) {
 	resp(data, err)
 }
 
+// rpcGenerate - Enqueues a build and returns its BuildJobID immediately
+// instead of blocking the RPC channel for the multi-minute obfuscate+compile
+// pipeline. Clients track progress via rpcBuildEvents and fetch the result
+// via rpcBuildArtifact.
 func rpcGenerate(req []byte, resp RPCResponse) {
 	genReq := &pb.GenerateReq{}
 	err := proto.Unmarshal(req, genReq)
@@ -49,6 +59,11 @@ func rpcGenerate(req []byte, resp RPCResponse) {
 		return
 	}
 	config := generate.SliverConfig{
+		// Name is part of the cache key (see BuildQueue.run/hashConfig); leaving
+		// it unset here would make populateIdentity mint a fresh random name
+		// and cert pair on every call, so identical regenerate requests could
+		// never hit the cache
+		Name:       genReq.Name,
 		GOOS:       genReq.OS,
 		GOARCH:     genReq.Arch,
 		MTLSServer: genReq.LHost,
@@ -57,21 +72,105 @@ func rpcGenerate(req []byte, resp RPCResponse) {
 		Debug:      genReq.Debug,
 	}
 
-	fpath, err := generate.SliverExecutable(config)
+	var build func(generate.SliverConfig, io.Writer) (string, error)
+	kind := "executable"
+	switch genReq.Format {
+	case pb.GenerateReq_SHARED_LIB:
+		kind = "shared_lib"
+		build = func(c generate.SliverConfig, stdout io.Writer) (string, error) {
+			return generate.SliverSharedLibrary(c, stdout)
+		}
+	case pb.GenerateReq_EGG:
+		stagerFormat := genReq.StagerFormat
+		kind = "egg:" + stagerFormat
+		build = func(c generate.SliverConfig, stdout io.Writer) (string, error) {
+			fpath, err := generate.SliverEgg(c, stdout)
+			if err != nil {
+				return "", err
+			}
+			return generate.PackageStager(fpath, c, stagerFormat)
+		}
+	default:
+		build = func(c generate.SliverConfig, stdout io.Writer) (string, error) {
+			return generate.SliverExecutable(c, stdout)
+		}
+	}
+
+	jobID := generate.DefaultBuildQueue.Enqueue(config, kind, build)
+	data, err := proto.Marshal(&pb.BuildJob{JobID: string(jobID)})
+	resp(data, err)
+}
+
+// rpcBuildEvents - Streams BuildEvents for a previously enqueued job: resp is
+// invoked once per event (Queued -> RenderingSource -> Obfuscating ->
+// Compiling -> Done|Failed) rather than once for the whole pipeline.
+func rpcBuildEvents(req []byte, resp RPCResponse) {
+	eventsReq := &pb.BuildEventsReq{}
+	if err := proto.Unmarshal(req, eventsReq); err != nil {
+		resp([]byte{}, err)
+		return
+	}
+	events := generate.DefaultBuildQueue.Events(generate.BuildJobID(eventsReq.JobID))
+	if events == nil {
+		resp([]byte{}, fmt.Errorf("unknown build job: %s", eventsReq.JobID))
+		return
+	}
+	for event := range events {
+		data, err := proto.Marshal(&pb.BuildEvent{
+			JobID:      string(event.JobID),
+			Type:       pb.BuildEventType(event.Type),
+			Line:       event.Line,
+			ArtifactID: event.ArtifactID,
+			Err:        event.Err,
+		})
+		resp(data, err)
+	}
+}
+
+// rpcBuildArtifact - Streams a completed build's bytes out in chunked frames
+// so large DLLs/ISOs don't need to fit in one protobuf message
+func rpcBuildArtifact(req []byte, resp RPCResponse) {
+	artifactReq := &pb.BuildArtifactReq{}
+	if err := proto.Unmarshal(req, artifactReq); err != nil {
+		resp([]byte{}, err)
+		return
+	}
+	fpath, err := generate.DefaultBuildQueue.Artifact(artifactReq.ArtifactID)
 	if err != nil {
 		resp([]byte{}, err)
 		return
 	}
-	filename := path.Base(fpath)
-	filedata, err := ioutil.ReadFile(fpath)
-	generated := &pb.Generate{
-		File: &pb.File{
-			Name: filename,
-			Data: filedata,
-		},
+	file, err := os.Open(fpath)
+	if err != nil {
+		resp([]byte{}, err)
+		return
+	}
+	defer file.Close()
+
+	buf := make([]byte, buildArtifactChunkSize)
+	for {
+		n, readErr := file.Read(buf)
+		if 0 < n {
+			data, err := proto.Marshal(&pb.BuildArtifactChunk{
+				Name: path.Base(fpath),
+				Data: buf[:n],
+			})
+			if err != nil {
+				resp([]byte{}, err)
+				return
+			}
+			resp(data, nil)
+		}
+		if readErr == io.EOF {
+			data, _ := proto.Marshal(&pb.BuildArtifactChunk{Eof: true})
+			resp(data, nil)
+			return
+		}
+		if readErr != nil {
+			resp([]byte{}, readErr)
+			return
+		}
 	}
-	data, err := proto.Marshal(generated)
-	resp(data, err)
 }
 
 func rpcProfiles(_ []byte, resp RPCResponse) {
